@@ -25,65 +25,19 @@ const (
 )
 
 var (
-	ErrPacketTooLarge = errors.New("exceed max size")
-	ErrNotSupported   = errors.New("feature not supported")
-	ErrUnexpectedType = errors.New("type not match")
+	ErrPacketTooLarge     = errors.New("exceed max size")
+	ErrNotSupported       = errors.New("feature not supported")
+	ErrUnexpectedType     = errors.New("type not match")
+	ErrLengthOverflow     = errors.New("declared length overflows platform int")
+	ErrNonMinimalEncoding = errors.New("non-minimal varnum encoding")
+	ErrTruncated          = errors.New("truncated tlv")
 )
 
-// Unmarshal reads arbitrary data from tlv.Reader
-func Unmarshal(buf Reader, i interface{}, valType uint64) error {
+// Unmarshal reads arbitrary data from a tlv.Reader
+func Unmarshal(buf *Reader, i interface{}, valType uint64) error {
 	return decode(buf, reflect.Indirect(reflect.ValueOf(i)), valType)
 }
 
-func readTLV(buf io.Reader) (t uint64, v []byte, err error) {
-	t, err = readVarNum(buf)
-	if err != nil {
-		return
-	}
-	l, err := readVarNum(buf)
-	if err != nil {
-		return
-	}
-	if l > maxSize {
-		err = ErrPacketTooLarge
-		return
-	}
-	v = make([]byte, int(l))
-	_, err = io.ReadFull(buf, v)
-	return
-}
-
-func readVarNum(buf io.Reader) (v uint64, err error) {
-	b := make([]byte, 8)
-	_, err = io.ReadFull(buf, b[:1])
-	if err != nil {
-		return
-	}
-	switch b[0] {
-	case 0xFF:
-		_, err = io.ReadFull(buf, b)
-		if err != nil {
-			return
-		}
-		v = binary.BigEndian.Uint64(b)
-	case 0xFE:
-		_, err = io.ReadFull(buf, b[:4])
-		if err != nil {
-			return
-		}
-		v = uint64(binary.BigEndian.Uint32(b[:4]))
-	case 0xFD:
-		_, err = io.ReadFull(buf, b[:2])
-		if err != nil {
-			return
-		}
-		v = uint64(binary.BigEndian.Uint16(b[:2]))
-	default:
-		v = uint64(b[0])
-	}
-	return
-}
-
 func decodeUint64(b []byte) uint64 {
 	switch len(b) {
 	case 8:
@@ -137,7 +91,12 @@ func decodeValue(v []byte, value reflect.Value) (err error) {
 			}
 		}
 	case reflect.Struct:
-		err = decodeStruct(NewReader(bytes.NewReader(v)), value)
+		// v is already bounded to its declared length by the caller's
+		// readTLV, so the nested Reader's budget is exactly len(v) rather
+		// than the legacy 8800-byte default, which would wrongly reject a
+		// nested field that fits comfortably under a caller-chosen
+		// NewReaderSize limit.
+		err = decodeStruct(NewReaderSize(bytes.NewReader(v), uint64(len(v))), value)
 		if err != nil {
 			return
 		}
@@ -148,34 +107,79 @@ func decodeValue(v []byte, value reflect.Value) (err error) {
 	return
 }
 
-func decode(buf Reader, value reflect.Value, valType uint64) (err error) {
+func decode(buf *Reader, value reflect.Value, valType uint64) (err error) {
+	if value.Kind() == reflect.Slice && value.Type().Elem().Kind() != reflect.Uint8 {
+		elemType := value.Type().Elem()
+		return UnmarshalStream(buf, valType, elemType, func(elem reflect.Value) error {
+			value.Set(reflect.Append(value, elem))
+			return nil
+		})
+	}
+
+	// A type mismatch is only conclusive when Peek found a complete type
+	// field; an incomplete one (truncated marker extension) must fall
+	// through to readTLV, whose error distinguishes clean EOF from
+	// genuine truncation instead of being mistaken for a different field.
+	if typ, ok := buf.Peek(); ok && typ != valType {
+		return ErrUnexpectedType
+	}
+	_, v, err := buf.readTLV()
+	if err != nil {
+		return
+	}
+	return decodeValue(v, value)
+}
+
+// UnmarshalStream reads repeated TLV elements of valType one at a time,
+// decoding each into a fresh elemType value and invoking yield, instead of
+// collecting the whole sequence into a slice before the caller sees
+// anything. Decoding stops as soon as yield returns a non-nil error, and
+// that error is returned to the caller; this lets callers process
+// multi-megabyte segmented objects, e.g. a repo listing, with bounded
+// memory.
+func UnmarshalStream(buf *Reader, valType uint64, elemType reflect.Type, yield func(reflect.Value) error) error {
 	var once bool
 	for {
-		if buf.Peek() != valType {
-			err = ErrUnexpectedType
-			break
+		// As in decode, a type mismatch is only conclusive when Peek found
+		// a complete type field; otherwise fall through to readTLV so a
+		// truncated marker surfaces its real error instead of looking like
+		// the end of the repeated run.
+		if typ, ok := buf.Peek(); ok && typ != valType {
+			if once {
+				return nil
+			}
+			return ErrUnexpectedType
 		}
-		var v []byte
-		_, v, err = readTLV(buf)
+		_, v, err := buf.readTLV()
 		if err != nil {
-			break
+			if errors.Is(err, io.EOF) {
+				if once {
+					return nil
+				}
+				return io.EOF
+			}
+			return err
 		}
-		err = decodeValue(v, value)
-		if err != nil {
-			break
+		elem := reflect.New(elemType).Elem()
+		if err := decodeValue(v, elem); err != nil {
+			return err
 		}
 		once = true
-		if value.Kind() != reflect.Slice || value.Type().Elem().Kind() == reflect.Uint8 {
-			break
+		if err := yield(elem); err != nil {
+			return err
 		}
 	}
-	if once {
-		err = nil
-	}
-	return
 }
 
-func decodeStruct(buf Reader, structValue reflect.Value) (err error) {
+// UnmarshalStreamT is the generic counterpart to UnmarshalStream.
+func UnmarshalStreamT[T any](buf *Reader, valType uint64, yield func(T) error) error {
+	elemType := reflect.TypeOf((*T)(nil)).Elem()
+	return UnmarshalStream(buf, valType, elemType, func(v reflect.Value) error {
+		return yield(v.Interface().(T))
+	})
+}
+
+func decodeStruct(buf *Reader, structValue reflect.Value) (err error) {
 	for i := 0; i < structValue.NumField(); i++ {
 		fieldValue := structValue.Field(i)
 		var tag *structTag
@@ -188,7 +192,11 @@ func decodeStruct(buf Reader, structValue reflect.Value) (err error) {
 		}
 		err = decode(buf, fieldValue, tag.Type)
 		if err != nil {
-			if tag.Optional {
+			// Only a cleanly absent field (EOF) or one belonging to a
+			// different, later tag (type mismatch) is legitimately
+			// optional; a truncated or otherwise malformed field must
+			// still surface even when the tag allows it to be missing.
+			if tag.Optional && (errors.Is(err, io.EOF) || errors.Is(err, ErrUnexpectedType)) {
 				err = nil
 			} else {
 				return
@@ -0,0 +1,56 @@
+package tlv
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type requiredRepeated struct {
+	Nums []uint64 `tlv:"5"`
+}
+
+type nestedInner struct {
+	Big []byte `tlv:"2"`
+}
+
+type nestedOuter struct {
+	Child nestedInner `tlv:"1"`
+}
+
+// TestNestedStructInheritsCallerLimit ensures a nested (non-repeated) struct
+// field is decoded with a budget of its own declared length, which the outer
+// Reader's configured budget already admitted, rather than the legacy
+// 8800-byte default: a 9000-byte inner field is over maxSize but well within
+// a 1 MiB NewReaderSize limit, so it must decode successfully.
+func TestNestedStructInheritsCallerLimit(t *testing.T) {
+	big := make([]byte, 9000)
+	inner := append([]byte{0x02, 0xFD, 0x23, 0x28}, big...) // type 2, length 9000
+	child := append([]byte{0x01, 0xFD, 0x23, 0x2C}, inner...) // type 1, length 9004
+	wrapped := append([]byte{0x09, 0xFD, 0x23, 0x30}, child...) // type 9, length 9008
+
+	v := new(nestedOuter)
+	err := Unmarshal(NewReaderSize(bytes.NewReader(wrapped), 1<<20), v, 9)
+	if err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+	if len(v.Child.Big) != 9000 {
+		t.Fatalf("got Big len %d, want 9000", len(v.Child.Big))
+	}
+}
+
+// TestRequiredRepeatedFieldErrorsWhenAbsent ensures a non-optional repeated
+// field with zero matching TLVs still errors instead of silently coming
+// back as an empty slice: decode must not swallow UnmarshalStream's
+// ErrUnexpectedType/io.EOF itself, leaving that to decodeStruct's existing
+// tag.Optional handling.
+func TestRequiredRepeatedFieldErrorsWhenAbsent(t *testing.T) {
+	inner := []byte{0x63, 0x00} // a single type-99 TLV with no value; type 5 never appears
+	wrapped := append([]byte{0x09, byte(len(inner))}, inner...)
+
+	v := new(requiredRepeated)
+	err := Unmarshal(NewReader(bytes.NewReader(wrapped)), v, 9)
+	if !errors.Is(err, ErrUnexpectedType) {
+		t.Fatalf("got %v, want ErrUnexpectedType", err)
+	}
+}
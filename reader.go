@@ -0,0 +1,190 @@
+package tlv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Reader wraps an io.Reader with TLV-aware peeking and a remaining-bytes
+// budget: every byte consumed through Read, including varnum headers, is
+// charged against the budget, so a declared TLV length that would exceed it
+// is rejected before the corresponding buffer is allocated.
+type Reader struct {
+	r      *bufio.Reader
+	remain uint64
+	strict bool
+}
+
+// ReaderOption configures optional Reader behavior.
+type ReaderOption func(*Reader)
+
+// Strict rejects non-minimal varnum encodings, e.g. a value of 252 or less
+// encoded with a 0xFD prefix instead of a single byte. NDN's TLV spec
+// requires minimum-length encoding, but this is opt-in since some peers
+// emit non-canonical forms and still expect to be understood.
+func Strict() ReaderOption {
+	return func(r *Reader) { r.strict = true }
+}
+
+// NewReader wraps r with the legacy 8800-byte default budget.
+func NewReader(r io.Reader, opts ...ReaderOption) *Reader {
+	return NewReaderSize(r, maxSize, opts...)
+}
+
+// NewReaderSize wraps r with a caller-chosen remaining-bytes budget, e.g. a
+// small limit for local links or a large one for bulk repo transfers.
+func NewReaderSize(r io.Reader, limit uint64, opts ...ReaderOption) *Reader {
+	rd := &Reader{r: bufio.NewReader(r), remain: limit}
+	for _, opt := range opts {
+		opt(rd)
+	}
+	return rd
+}
+
+// Read implements io.Reader, charging every byte actually read against the
+// remaining budget.
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if uint64(n) > r.remain {
+			r.remain = 0
+		} else {
+			r.remain -= uint64(n)
+		}
+	}
+	return n, err
+}
+
+// Peek returns the type number of the next TLV without consuming it. ok is
+// true only when a complete type field is currently available. It is false
+// both when the stream is cleanly exhausted and when the type marker's
+// extension bytes are truncated; callers must not treat !ok as "absent" on
+// its own and should read through via readTLV, whose error distinguishes a
+// clean io.EOF from a genuine truncation.
+func (r *Reader) Peek() (typ uint64, ok bool) {
+	b, err := r.r.Peek(1)
+	if err != nil {
+		return 0, false
+	}
+	full, err := r.r.Peek(varNumWidth(b[0]))
+	if err != nil {
+		return 0, false
+	}
+	return decodeVarNum(full), true
+}
+
+func varNumWidth(marker byte) int {
+	switch marker {
+	case 0xFF:
+		return 9
+	case 0xFE:
+		return 5
+	case 0xFD:
+		return 3
+	default:
+		return 1
+	}
+}
+
+func decodeVarNum(b []byte) uint64 {
+	switch b[0] {
+	case 0xFF:
+		return binary.BigEndian.Uint64(b[1:9])
+	case 0xFE:
+		return uint64(binary.BigEndian.Uint32(b[1:5]))
+	case 0xFD:
+		return uint64(binary.BigEndian.Uint16(b[1:3]))
+	default:
+		return uint64(b[0])
+	}
+}
+
+// truncated wraps an error from a read that followed at least one already
+// consumed byte of the current TLV, rewriting a clean io.EOF to
+// io.ErrUnexpectedEOF and wrapping the result as ErrTruncated so callers can
+// log and drop the peer instead of treating it as a generic decode failure.
+func truncated(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%w: %w", ErrTruncated, err)
+}
+
+func (r *Reader) readVarNum() (v uint64, err error) {
+	b := make([]byte, 8)
+	_, err = io.ReadFull(r, b[:1])
+	if err != nil {
+		return
+	}
+	switch b[0] {
+	case 0xFF:
+		_, err = io.ReadFull(r, b)
+		if err != nil {
+			err = truncated(err)
+			return
+		}
+		v = binary.BigEndian.Uint64(b)
+		if r.strict && v <= math.MaxUint32 {
+			err = ErrNonMinimalEncoding
+		}
+	case 0xFE:
+		_, err = io.ReadFull(r, b[:4])
+		if err != nil {
+			err = truncated(err)
+			return
+		}
+		v = uint64(binary.BigEndian.Uint32(b[:4]))
+		if r.strict && v <= math.MaxUint16 {
+			err = ErrNonMinimalEncoding
+		}
+	case 0xFD:
+		_, err = io.ReadFull(r, b[:2])
+		if err != nil {
+			err = truncated(err)
+			return
+		}
+		v = uint64(binary.BigEndian.Uint16(b[:2]))
+		if r.strict && v <= 252 {
+			err = ErrNonMinimalEncoding
+		}
+	default:
+		v = uint64(b[0])
+	}
+	return
+}
+
+func (r *Reader) readTLV() (t uint64, v []byte, err error) {
+	t, err = r.readVarNum()
+	if err != nil {
+		return
+	}
+	var l uint64
+	l, err = r.readVarNum()
+	if err != nil {
+		if !errors.Is(err, ErrNonMinimalEncoding) {
+			err = truncated(err)
+		}
+		return
+	}
+	if l > math.MaxInt {
+		err = ErrLengthOverflow
+		return
+	}
+	if l > r.remain {
+		err = ErrPacketTooLarge
+		return
+	}
+	v = make([]byte, int(l))
+	_, err = io.ReadFull(r, v)
+	if err != nil {
+		err = truncated(err)
+	}
+	return
+}
@@ -0,0 +1,28 @@
+package tlv
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type optField struct {
+	Mandatory uint64 `tlv:"1"`
+	Maybe     uint64 `tlv:"5,optional"`
+}
+
+// TestOptionalFieldTruncatedMarkerNotSwallowed reproduces a truncated type
+// marker (a lone 0xFD with its two extension bytes missing) following a
+// mandatory field. Peek cannot tell this apart from "nothing left" on its
+// own, so decode must read through and let the real truncation surface
+// instead of decodeStruct mistaking it for the optional field's absence.
+func TestOptionalFieldTruncatedMarkerNotSwallowed(t *testing.T) {
+	inner := []byte{0x01, 0x01, 0x07, 0xFD} // mandatory field, then a truncated marker
+	wrapped := append([]byte{0x09, byte(len(inner))}, inner...)
+
+	v := new(optField)
+	err := Unmarshal(NewReader(bytes.NewReader(wrapped)), v, 9)
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("got %v, want ErrTruncated", err)
+	}
+}
@@ -0,0 +1,435 @@
+package tlv
+
+import (
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+// Encoder writes val to w, using buf as scratch space so that encoding a
+// fixed-size primitive never allocates.
+type Encoder func(w io.Writer, val interface{}, buf *[8]byte) error
+
+// Decoder reads l bytes from r into val, using buf as scratch space so that
+// decoding a fixed-size primitive never allocates.
+type Decoder func(r io.Reader, val interface{}, buf *[8]byte, l uint64) error
+
+// Record binds a TLV type number to a value pointer, its encoded size, and
+// the Encoder/Decoder pair that moves bytes in and out of it. Record is the
+// building block of a Stream and, unlike Marshal/Unmarshal, never touches
+// reflect.
+type Record struct {
+	typ      uint64
+	value    interface{}
+	size     uint64
+	sizeFunc func() uint64
+	encoder  Encoder
+	decoder  Decoder
+}
+
+// MakeStaticRecord creates a Record whose encoded size is fixed and known
+// up front, such as a uint8/16/32/64.
+func MakeStaticRecord(typ uint64, value interface{}, size uint64, encoder Encoder, decoder Decoder) Record {
+	return Record{
+		typ:     typ,
+		value:   value,
+		size:    size,
+		encoder: encoder,
+		decoder: decoder,
+	}
+}
+
+// MakeDynamicRecord creates a Record whose encoded size must be computed at
+// encode time, such as a byte slice, string, or nested Stream.
+func MakeDynamicRecord(typ uint64, value interface{}, sizeFunc func() uint64, encoder Encoder, decoder Decoder) Record {
+	return Record{
+		typ:      typ,
+		value:    value,
+		sizeFunc: sizeFunc,
+		encoder:  encoder,
+		decoder:  decoder,
+	}
+}
+
+// Type returns the record's TLV type number.
+func (r *Record) Type() uint64 {
+	return r.typ
+}
+
+// Size returns the record's current encoded size.
+func (r *Record) Size() uint64 {
+	if r.sizeFunc != nil {
+		return r.sizeFunc()
+	}
+	return r.size
+}
+
+// NewTypeForEncodingErr reports that val does not have the Go type an
+// Encoder or Decoder expected for expType.
+func NewTypeForEncodingErr(val interface{}, expType string) error {
+	return fmt.Errorf("tlv: value %v (%T) is not of expected type %v", val, val, expType)
+}
+
+// Stream is a reflection-free codec over a fixed list of Records, sorted by
+// ascending type number. It is the high-throughput counterpart to
+// Marshal/Unmarshal for callers on a hot path, such as a forwarder parsing
+// NDN packets, and never uses reflect.
+type Stream struct {
+	records []Record
+}
+
+var scratchPool = sync.Pool{New: func() interface{} { return new([8]byte) }}
+
+// NewStream builds a Stream from records, which must already be sorted by
+// strictly ascending type number; this is the order records are encoded in,
+// and Decode relies on it to look a record up by type with a binary search.
+func NewStream(records ...Record) (*Stream, error) {
+	for i := 1; i < len(records); i++ {
+		if records[i].typ <= records[i-1].typ {
+			return nil, fmt.Errorf("tlv: records must be sorted by strictly ascending type, got %d before %d", records[i-1].typ, records[i].typ)
+		}
+	}
+	return &Stream{records: records}, nil
+}
+
+// Encode writes every record in s to w in ascending type order, reusing a
+// single scratch buffer across fields. The buffer is taken from a pool, so
+// encoding fixed-size primitives does not allocate.
+func (s *Stream) Encode(w io.Writer) error {
+	buf := scratchPool.Get().(*[8]byte)
+	defer scratchPool.Put(buf)
+	for i := range s.records {
+		r := &s.records[i]
+		if err := writeVarNumScratch(w, r.typ, buf); err != nil {
+			return err
+		}
+		if err := writeVarNumScratch(w, r.Size(), buf); err != nil {
+			return err
+		}
+		if err := r.encoder(w, r.value, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decode reads TLV records from r, dispatching each to the Record in s with
+// the matching type number, bounding every declared length to the legacy
+// 8800-byte maxSize. A record present in the stream but absent from s is
+// skipped; a Record in s absent from the stream is simply left untouched.
+func (s *Stream) Decode(r io.Reader) error {
+	return s.DecodeLimit(r, maxSize)
+}
+
+// DecodeLimit behaves like Decode, but bounds every record's declared
+// length to limit instead of the legacy 8800-byte default, so a malicious
+// or malformed length prefix fails fast with ErrLengthOverflow or
+// ErrPacketTooLarge before any decoder allocates.
+func (s *Stream) DecodeLimit(r io.Reader, limit uint64) error {
+	var buf [8]byte
+	for {
+		typ, err := readVarNumScratch(r, &buf)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		l, err := readVarNumScratch(r, &buf)
+		if err != nil {
+			return err
+		}
+		if l > limit {
+			return ErrPacketTooLarge
+		}
+		if l > math.MaxInt {
+			return ErrLengthOverflow
+		}
+		i := searchRecords(s.records, typ)
+		if i < len(s.records) && s.records[i].typ == typ {
+			if err := s.records[i].decoder(r, s.records[i].value, &buf, l); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(l)); err != nil {
+			return err
+		}
+	}
+}
+
+// searchRecords returns the index of the first record with typ >= the given
+// type, or len(records) if there is none. It is a plain binary search, not
+// sort.Search, so the per-record dispatch in DecodeLimit never allocates a
+// closure.
+func searchRecords(records []Record, typ uint64) int {
+	lo, hi := 0, len(records)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if records[mid].typ < typ {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// writeVarNumScratch writes the marker byte and, for multi-byte forms, the
+// value into buf itself before handing it to w, instead of a fresh local
+// array, so it doesn't allocate on top of the caller's already-amortized
+// scratch buffer.
+func writeVarNumScratch(w io.Writer, v uint64, buf *[8]byte) error {
+	switch {
+	case v < 0xFD:
+		buf[0] = byte(v)
+		_, err := w.Write(buf[:1])
+		return err
+	case v <= 0xFFFF:
+		buf[0] = 0xFD
+		binary.BigEndian.PutUint16(buf[1:3], uint16(v))
+		_, err := w.Write(buf[:3])
+		return err
+	case v <= 0xFFFFFFFF:
+		buf[0] = 0xFE
+		binary.BigEndian.PutUint32(buf[1:5], uint32(v))
+		_, err := w.Write(buf[:5])
+		return err
+	default:
+		buf[0] = 0xFF
+		if _, err := w.Write(buf[:1]); err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint64(buf[:8], v)
+		_, err := w.Write(buf[:8])
+		return err
+	}
+}
+
+func readVarNumScratch(r io.Reader, buf *[8]byte) (uint64, error) {
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return 0, err
+	}
+	switch buf[0] {
+	case 0xFF:
+		if _, err := io.ReadFull(r, buf[:8]); err != nil {
+			return 0, err
+		}
+		return binary.BigEndian.Uint64(buf[:8]), nil
+	case 0xFE:
+		if _, err := io.ReadFull(r, buf[:4]); err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint32(buf[:4])), nil
+	case 0xFD:
+		if _, err := io.ReadFull(r, buf[:2]); err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint16(buf[:2])), nil
+	default:
+		return uint64(buf[0]), nil
+	}
+}
+
+// EUint8 is an Encoder for *uint8 values.
+func EUint8(w io.Writer, val interface{}, buf *[8]byte) error {
+	v, ok := val.(*uint8)
+	if !ok {
+		return NewTypeForEncodingErr(val, "uint8")
+	}
+	buf[0] = *v
+	_, err := w.Write(buf[:1])
+	return err
+}
+
+// DUint8 is a Decoder for *uint8 values.
+func DUint8(r io.Reader, val interface{}, buf *[8]byte, l uint64) error {
+	v, ok := val.(*uint8)
+	if !ok {
+		return NewTypeForEncodingErr(val, "uint8")
+	}
+	if l != 1 {
+		return fmt.Errorf("tlv: uint8 field must be 1 byte, got %d", l)
+	}
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return err
+	}
+	*v = buf[0]
+	return nil
+}
+
+// EUint16 is an Encoder for *uint16 values.
+func EUint16(w io.Writer, val interface{}, buf *[8]byte) error {
+	v, ok := val.(*uint16)
+	if !ok {
+		return NewTypeForEncodingErr(val, "uint16")
+	}
+	binary.BigEndian.PutUint16(buf[:2], *v)
+	_, err := w.Write(buf[:2])
+	return err
+}
+
+// DUint16 is a Decoder for *uint16 values.
+func DUint16(r io.Reader, val interface{}, buf *[8]byte, l uint64) error {
+	v, ok := val.(*uint16)
+	if !ok {
+		return NewTypeForEncodingErr(val, "uint16")
+	}
+	if l != 2 {
+		return fmt.Errorf("tlv: uint16 field must be 2 bytes, got %d", l)
+	}
+	if _, err := io.ReadFull(r, buf[:2]); err != nil {
+		return err
+	}
+	*v = binary.BigEndian.Uint16(buf[:2])
+	return nil
+}
+
+// EUint32 is an Encoder for *uint32 values.
+func EUint32(w io.Writer, val interface{}, buf *[8]byte) error {
+	v, ok := val.(*uint32)
+	if !ok {
+		return NewTypeForEncodingErr(val, "uint32")
+	}
+	binary.BigEndian.PutUint32(buf[:4], *v)
+	_, err := w.Write(buf[:4])
+	return err
+}
+
+// DUint32 is a Decoder for *uint32 values.
+func DUint32(r io.Reader, val interface{}, buf *[8]byte, l uint64) error {
+	v, ok := val.(*uint32)
+	if !ok {
+		return NewTypeForEncodingErr(val, "uint32")
+	}
+	if l != 4 {
+		return fmt.Errorf("tlv: uint32 field must be 4 bytes, got %d", l)
+	}
+	if _, err := io.ReadFull(r, buf[:4]); err != nil {
+		return err
+	}
+	*v = binary.BigEndian.Uint32(buf[:4])
+	return nil
+}
+
+// EUint64 is an Encoder for *uint64 values.
+func EUint64(w io.Writer, val interface{}, buf *[8]byte) error {
+	v, ok := val.(*uint64)
+	if !ok {
+		return NewTypeForEncodingErr(val, "uint64")
+	}
+	binary.BigEndian.PutUint64(buf[:8], *v)
+	_, err := w.Write(buf[:8])
+	return err
+}
+
+// DUint64 is a Decoder for *uint64 values.
+func DUint64(r io.Reader, val interface{}, buf *[8]byte, l uint64) error {
+	v, ok := val.(*uint64)
+	if !ok {
+		return NewTypeForEncodingErr(val, "uint64")
+	}
+	if l != 8 {
+		return fmt.Errorf("tlv: uint64 field must be 8 bytes, got %d", l)
+	}
+	if _, err := io.ReadFull(r, buf[:8]); err != nil {
+		return err
+	}
+	*v = binary.BigEndian.Uint64(buf[:8])
+	return nil
+}
+
+// EVarBytes is an Encoder for *[]byte values of any length.
+func EVarBytes(w io.Writer, val interface{}, buf *[8]byte) error {
+	v, ok := val.(*[]byte)
+	if !ok {
+		return NewTypeForEncodingErr(val, "[]byte")
+	}
+	_, err := w.Write(*v)
+	return err
+}
+
+// DVarBytes is a Decoder for *[]byte values of any length.
+func DVarBytes(r io.Reader, val interface{}, buf *[8]byte, l uint64) error {
+	v, ok := val.(*[]byte)
+	if !ok {
+		return NewTypeForEncodingErr(val, "[]byte")
+	}
+	*v = make([]byte, l)
+	_, err := io.ReadFull(r, *v)
+	return err
+}
+
+// EString is an Encoder for *string values.
+func EString(w io.Writer, val interface{}, buf *[8]byte) error {
+	v, ok := val.(*string)
+	if !ok {
+		return NewTypeForEncodingErr(val, "string")
+	}
+	_, err := io.WriteString(w, *v)
+	return err
+}
+
+// DString is a Decoder for *string values.
+func DString(r io.Reader, val interface{}, buf *[8]byte, l uint64) error {
+	v, ok := val.(*string)
+	if !ok {
+		return NewTypeForEncodingErr(val, "string")
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	*v = string(b)
+	return nil
+}
+
+// EStream is an Encoder for a nested *Stream.
+func EStream(w io.Writer, val interface{}, buf *[8]byte) error {
+	v, ok := val.(*Stream)
+	if !ok {
+		return NewTypeForEncodingErr(val, "*Stream")
+	}
+	return v.Encode(w)
+}
+
+// DStream is a Decoder for a nested *Stream; l bounds the nested stream to
+// its declared length so it cannot read past the end of the parent record.
+func DStream(r io.Reader, val interface{}, buf *[8]byte, l uint64) error {
+	v, ok := val.(*Stream)
+	if !ok {
+		return NewTypeForEncodingErr(val, "*Stream")
+	}
+	return v.Decode(io.LimitReader(r, int64(l)))
+}
+
+// EMarshaler adapts an encoding.BinaryMarshaler to the Encoder signature.
+func EMarshaler(w io.Writer, val interface{}, buf *[8]byte) error {
+	v, ok := val.(encoding.BinaryMarshaler)
+	if !ok {
+		return NewTypeForEncodingErr(val, "encoding.BinaryMarshaler")
+	}
+	b, err := v.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// DUnmarshaler adapts an encoding.BinaryUnmarshaler to the Decoder
+// signature.
+func DUnmarshaler(r io.Reader, val interface{}, buf *[8]byte, l uint64) error {
+	v, ok := val.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return NewTypeForEncodingErr(val, "encoding.BinaryUnmarshaler")
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	return v.UnmarshalBinary(b)
+}
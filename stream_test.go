@@ -0,0 +1,80 @@
+package tlv
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestStreamRoundTrip(t *testing.T) {
+	var in, out uint32
+	in = 0xDEADBEEF
+	s, err := NewStream(MakeStaticRecord(1, &in, 4, EUint32, DUint32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := s.Encode(buf); err != nil {
+		t.Fatal(err)
+	}
+	s2, err := NewStream(MakeStaticRecord(1, &out, 4, EUint32, DUint32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.Decode(buf); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Fatalf("got %x, want %x", out, in)
+	}
+}
+
+// TestStreamDecodeRejectsOversizedLength reproduces a declared length of
+// 0xFFFFFFFFFFFFFFFF following a single-byte type, which previously reached
+// a Decoder's make([]byte, l) unchecked and panicked.
+func TestStreamDecodeRejectsOversizedLength(t *testing.T) {
+	var out []byte
+	s, err := NewStream(MakeDynamicRecord(1, &out, func() uint64 { return 0 }, EVarBytes, DVarBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	malicious := []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	err = s.Decode(bytes.NewReader(malicious))
+	if !errors.Is(err, ErrPacketTooLarge) {
+		t.Fatalf("got %v, want ErrPacketTooLarge", err)
+	}
+}
+
+func TestStreamDecodeLimit(t *testing.T) {
+	var out []byte
+	s, err := NewStream(MakeDynamicRecord(1, &out, func() uint64 { return 0 }, EVarBytes, DVarBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := []byte{0x01, 0xFD, 0x01, 0x00} // declares a 256-byte value
+	err = s.DecodeLimit(bytes.NewReader(encoded), 64)
+	if !errors.Is(err, ErrPacketTooLarge) {
+		t.Fatalf("got %v, want ErrPacketTooLarge", err)
+	}
+}
+
+// TestStreamEncodeStaticFieldAllocFree guards the "zero-allocation per
+// field for fixed-size primitives" goal: encoding a single static uint64
+// record must not allocate on the hot path.
+func TestStreamEncodeStaticFieldAllocFree(t *testing.T) {
+	var v uint64 = 0xDEADBEEF
+	s, err := NewStream(MakeStaticRecord(1, &v, 8, EUint64, DUint64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	avg := testing.AllocsPerRun(100, func() {
+		buf.Reset()
+		if err := s.Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if avg != 0 {
+		t.Fatalf("Stream.Encode allocated %v times per run, want 0", avg)
+	}
+}